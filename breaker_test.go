@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	b := newCircuitBreaker(3, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if !b.allow() {
+			t.Fatalf("attempt %d: expected breaker to allow while below threshold", i)
+		}
+		b.failure()
+	}
+
+	if !b.allow() {
+		t.Fatal("expected breaker to still allow on the attempt that reaches the threshold")
+	}
+	b.failure()
+
+	if b.allow() {
+		t.Fatal("expected breaker to be open once threshold consecutive failures were recorded")
+	}
+}
+
+func TestCircuitBreakerSuccessResetsFailures(t *testing.T) {
+	b := newCircuitBreaker(2, time.Minute)
+
+	b.failure()
+	b.success()
+	b.failure()
+
+	if !b.allow() {
+		t.Fatal("a success should reset the failure count, so a single subsequent failure must not open the breaker")
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbe(t *testing.T) {
+	b := newCircuitBreaker(1, 10*time.Millisecond)
+
+	b.failure()
+	if b.allow() {
+		t.Fatal("expected breaker to be open immediately after crossing the threshold")
+	}
+
+	time.Sleep(15 * time.Millisecond)
+
+	if !b.allow() {
+		t.Fatal("expected breaker to allow exactly one half-open probe once cooldown elapsed")
+	}
+	if b.allow() {
+		t.Fatal("expected breaker to reject further attempts while the probe is outstanding")
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbeFailureReopens(t *testing.T) {
+	b := newCircuitBreaker(1, 10*time.Millisecond)
+
+	b.failure()
+	time.Sleep(15 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("expected the half-open probe to be allowed")
+	}
+
+	b.failure()
+	if b.allow() {
+		t.Fatal("expected a failed probe to re-open the breaker for another cooldown")
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbeSuccessCloses(t *testing.T) {
+	b := newCircuitBreaker(1, 10*time.Millisecond)
+
+	b.failure()
+	time.Sleep(15 * time.Millisecond)
+	if !b.allow() {
+		t.Fatal("expected the half-open probe to be allowed")
+	}
+
+	b.success()
+	if !b.allow() {
+		t.Fatal("expected the breaker to be closed after a successful probe")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"lib.hemtjan.st/client"
+	"lib.hemtjan.st/device"
+)
+
+// discoveredStation identifies a weather station without its sensor
+// readings, as returned by the lightweight discover query.
+type discoveredStation struct {
+	id   string
+	name string
+}
+
+// discoverStations runs a lightweight query returning only station
+// identity and location and is used by -discover mode to find which
+// stations currently match the configured selectors.
+func discoverStations(ctx context.Context, client *http.Client, body []byte) ([]discoveredStation, error) {
+	wr, err := doFetch(ctx, client, body)
+	if err != nil {
+		return nil, err
+	}
+
+	stations := make([]discoveredStation, 0, len(wr.Results[0].Data))
+	for _, mp := range wr.Results[0].Data {
+		stations = append(stations, discoveredStation{id: *mp.ID(), name: *mp.Name()})
+	}
+
+	return stations, nil
+}
+
+// resolveFetchQuery re-discovers which stations currently match the
+// selectors and builds a full-fields query for exactly those. If
+// discovery fails, or discover mode is disabled, it returns fallback
+// (the previously resolved query) unchanged.
+func resolveFetchQuery(ctx context.Context, apiToken string, discoverQuery []byte, discover bool, features featureFlags, timeout time.Duration, fallback []byte, log *slog.Logger) []byte {
+	if !discover {
+		return fallback
+	}
+
+	dctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	discovered, err := discoverStations(dctx, http.DefaultClient, discoverQuery)
+	if err != nil {
+		log.Warn("discover: lookup failed, reusing last known station set", "err", err)
+		return fallback
+	}
+
+	ids := make([]string, len(discovered))
+	for i, s := range discovered {
+		ids[i] = s.id
+	}
+
+	idQuery, err := buildIDQuery(apiToken, ids, features)
+	if err != nil {
+		log.Warn("discover: invalid id query, reusing last known station set", "err", err)
+		return fallback
+	}
+
+	log.Info("discover: station set resolved", "count", len(ids))
+	return idQuery
+}
+
+// syncStations registers an MQTT device for every station present in
+// data but not yet in stations, and drops entries for stations that
+// stopped appearing in the results, marking them unavailable to sinks.
+// cadence is told to forget the same stations so its stale cadence
+// estimate for a vanished station can't pin the adaptive poll interval.
+func syncStations(stations map[string]client.Device, data []sensor, features featureFlags, tr device.Transport, cadence *cadenceTracker) {
+	seen := make(map[string]bool, len(data))
+	for _, item := range data {
+		seen[item.id] = true
+		if _, ok := stations[item.id]; ok {
+			continue
+		}
+		station := newWeatherStation(item.name, item.id, features, tr)
+		if err := station.Feature("reachable").Update("true"); err != nil {
+			slog.Warn("station appeared but failed to publish reachable state", "station_id", item.id, "err", err)
+		}
+		stations[item.id] = station
+		slog.Info("station appeared, registering", "station_id", item.id, "station_name", item.name)
+	}
+
+	for id, station := range stations {
+		if seen[id] {
+			continue
+		}
+		if err := station.Feature("reachable").Update("false"); err != nil {
+			slog.Warn("station disappeared but failed to publish unavailable state", "station_id", id, "err", err)
+		}
+		delete(stations, id)
+		cadence.forget(id)
+		slog.Info("station disappeared, marking unavailable", "station_id", id)
+	}
+}
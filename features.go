@@ -0,0 +1,49 @@
+package main
+
+// featureFlags controls which optional WeatherMeasurepoint fields are
+// requested from the Trafikinfo API. Temperature, humidity, precipitation
+// and the sample timestamp are always included; everything else is
+// opt-in so the default query payload stays small. Air pressure and
+// precipitation type aren't in the WeatherMeasurepoint v2 schema at all,
+// so there's no flag for them.
+type featureFlags struct {
+	wind       bool
+	dewPoint   bool
+	visibility bool
+	road       bool
+}
+
+// includeFields returns the Trafikinfo Include() field list matching the
+// enabled features.
+func (f featureFlags) includeFields() []string {
+	fields := []string{
+		"Id", "Name",
+		"Observation.Air.Temperature.Value",
+		"Observation.Air.RelativeHumidity.Value",
+		"Observation.Aggregated30minutes.Precipitation.TotalWaterEquivalent.Value",
+		"Observation.Sample",
+	}
+
+	if f.wind {
+		fields = append(fields,
+			"Observation.Wind.Speed.Value",
+			"Observation.Wind.Direction.Value",
+		)
+	}
+	if f.dewPoint {
+		fields = append(fields, "Observation.Air.Dewpoint.Value")
+	}
+	if f.visibility {
+		fields = append(fields, "Observation.Air.VisibleDistance.Value")
+	}
+	if f.road {
+		fields = append(fields,
+			"Observation.Surface.Temperature.Value",
+			"Observation.Surface.Water",
+			"Observation.Surface.Ice",
+			"Observation.Surface.Snow",
+		)
+	}
+
+	return fields
+}
@@ -8,19 +8,44 @@ import (
 	"lib.hemtjan.st/feature"
 )
 
-func newWeatherStation(name, id string, tr device.Transport) client.Device {
+// newWeatherStation registers a hemtjänst device for a station. Only the
+// core features (always included in every fetch, see featureFlags),
+// "history" and "reachable" are unconditionally registered; the optional
+// features are added to match whichever featureFlags are enabled, so a
+// station never advertises a hemtjänst feature it will never receive a
+// value for.
+func newWeatherStation(name, id string, features featureFlags, tr device.Transport) client.Device {
+	feats := map[string]*feature.Info{
+		"currentTemperature": {
+			Min: -50,
+		},
+		"currentRelativeHumidity": {},
+		"precipitation":           {},
+		"history":                 {},
+		"reachable":               {},
+	}
+
+	if features.wind {
+		feats["windSpeed"] = &feature.Info{}
+		feats["windDirection"] = &feature.Info{Min: 0, Max: 360}
+	}
+	if features.dewPoint {
+		feats["dewPoint"] = &feature.Info{}
+	}
+	if features.visibility {
+		feats["visibility"] = &feature.Info{}
+	}
+	if features.road {
+		feats["roadTemperature"] = &feature.Info{Min: -50}
+		feats["roadCondition"] = &feature.Info{}
+	}
+
 	dev, _ := client.NewDevice(&device.Info{
 		Topic:        fmt.Sprintf("sensor/environment/%s", id),
 		Manufacturer: "trafikväder",
 		Name:         fmt.Sprintf("%s (%s)", name, id),
 		Type:         "weatherStation",
-		Features: map[string]*feature.Info{
-			"currentTemperature": {
-				Min: -50,
-			},
-			"currentRelativeHumidity": {},
-			"precipitation":           {},
-		},
+		Features:     feats,
 	}, tr)
 
 	return dev
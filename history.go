@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// historyEntry is a single buffered sample used to render the trend blob
+// published on the "history" feature.
+type historyEntry struct {
+	at     time.Time
+	tempC  float64
+	rhPct  float64
+	precip float64
+}
+
+// HistoryStore buffers the last N samples per station so MQTT subscribers
+// can render a trend graph even though Trafikinfo only refreshes every
+// ~30 minutes. The blob it renders is a private encoding understood only
+// by this package, not the real fakegato/Eve history wire format (which
+// needs a signature/refTime handshake over a separate characteristic) —
+// it is not decodable by the Eve app or other HomeKit history clients.
+type HistoryStore struct {
+	size int
+
+	mu      sync.Mutex
+	entries map[string][]historyEntry
+}
+
+// NewHistoryStore creates a store that keeps up to size samples per
+// station.
+func NewHistoryStore(size int) *HistoryStore {
+	return &HistoryStore{size: size, entries: map[string][]historyEntry{}}
+}
+
+// Record appends item to the station's buffer, dropping the oldest entry
+// once the buffer is full.
+func (h *HistoryStore) Record(item sensor) {
+	if h.size <= 0 || item.sampleAt.IsZero() {
+		return
+	}
+
+	entry := historyEntry{at: item.sampleAt}
+	if item.tempC != nil {
+		entry.tempC = *item.tempC
+	}
+	if item.rhPct != nil {
+		entry.rhPct = *item.rhPct
+	}
+	if item.precip != nil {
+		entry.precip = precipRateMmPerHour(*item.precip)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	buf := append(h.entries[item.id], entry)
+	if len(buf) > h.size {
+		buf = buf[len(buf)-h.size:]
+	}
+	h.entries[item.id] = buf
+}
+
+// Blob renders the buffered samples for a station as a base64-encoded
+// sequence of fixed-width records (unix timestamp, temperature and
+// humidity in centi-units, precipitation in centi-mm/h). This is a
+// private trend encoding, not the real Eve/fakegato history format.
+func (h *HistoryStore) Blob(id string) string {
+	h.mu.Lock()
+	buf := append([]historyEntry(nil), h.entries[id]...)
+	h.mu.Unlock()
+
+	if len(buf) == 0 {
+		return ""
+	}
+
+	out := make([]byte, 0, len(buf)*16)
+	for _, e := range buf {
+		var rec [16]byte
+		binary.LittleEndian.PutUint32(rec[0:4], uint32(e.at.Unix()))
+		binary.LittleEndian.PutUint16(rec[4:6], uint16(int16(e.tempC*100)))
+		binary.LittleEndian.PutUint16(rec[6:8], uint16(int16(e.rhPct*100)))
+		binary.LittleEndian.PutUint16(rec[8:10], uint16(int16(e.precip*100)))
+		out = append(out, rec[:]...)
+	}
+
+	return base64.StdEncoding.EncodeToString(out)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+)
+
+// InfluxSink writes sensor readings to an InfluxDB v2 bucket as line
+// protocol, one point per fetch per station.
+type InfluxSink struct {
+	client  influxdb2.Client
+	write   api.WriteAPIBlocking
+	timeout time.Duration
+}
+
+// NewInfluxSink opens a connection to the given InfluxDB v2 instance and
+// returns a Sink that writes points to org/bucket using the measurement
+// "weather". Each write is bounded by timeout so an unreachable or slow
+// InfluxDB can't stall update()'s caller, which also drives MQTT
+// publishing and the next scheduled fetch.
+func NewInfluxSink(url, token, org, bucket string, timeout time.Duration) *InfluxSink {
+	c := influxdb2.NewClient(url, token)
+	return &InfluxSink{
+		client:  c,
+		write:   c.WriteAPIBlocking(org, bucket),
+		timeout: timeout,
+	}
+}
+
+func (s *InfluxSink) Publish(item sensor) error {
+	fields := map[string]interface{}{}
+	if item.tempC != nil {
+		fields["temp_c"] = *item.tempC
+	}
+	if item.rhPct != nil {
+		fields["rh_pct"] = *item.rhPct
+	}
+	if item.precip != nil {
+		fields["precip_mm_per_hour"] = precipRateMmPerHour(*item.precip)
+	}
+	if item.windSpeed != nil {
+		fields["wind_speed_ms"] = *item.windSpeed
+	}
+	if item.windDirection != nil {
+		fields["wind_direction_deg"] = *item.windDirection
+	}
+	if item.dewPoint != nil {
+		fields["dew_point_c"] = *item.dewPoint
+	}
+	if item.visibility != nil {
+		fields["visibility_m"] = *item.visibility
+	}
+	if item.roadTemp != nil {
+		fields["road_temp_c"] = *item.roadTemp
+	}
+	if item.roadCondition != nil {
+		fields["road_condition"] = *item.roadCondition
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	p := influxdb2.NewPoint(
+		"weather",
+		map[string]string{
+			"station_id":   item.id,
+			"station_name": item.name,
+		},
+		fields,
+		item.sampleAt,
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	if err := s.write.WritePoint(ctx, p); err != nil {
+		return fmt.Errorf("influx: failed to write point: %w", err)
+	}
+
+	return nil
+}
+
+// Close releases the underlying InfluxDB client.
+func (s *InfluxSink) Close() {
+	s.client.Close()
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+)
+
+// configureLogging builds the process-wide structured logger from the
+// -log-format and -log-level flags and installs it as the slog default,
+// so every package in the binary can just call slog.Info/Error/etc.
+func configureLogging(format, level string) {
+	opts := &slog.HandlerOptions{Level: parseLevel(level)}
+
+	var handler slog.Handler
+	switch format {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+
+	slog.SetDefault(slog.New(handler))
+}
+
+func parseLevel(level string) slog.Level {
+	switch level {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
@@ -7,12 +7,13 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"code.dny.dev/trafikinfo"
@@ -27,6 +28,15 @@ var (
 	date    = "unknown"
 )
 
+var fetchCounter atomic.Uint64
+
+// nextFetchID returns a short, monotonically increasing id used to
+// correlate the log lines belonging to a single fetch cycle, including
+// its retries.
+func nextFetchID() string {
+	return "fetch-" + strconv.FormatUint(fetchCounter.Add(1), 10)
+}
+
 type stationNamesFlag []string
 
 func (s *stationNamesFlag) String() string {
@@ -52,154 +62,215 @@ func main() {
 		fmt.Fprintf(os.Stderr, "\n")
 	}
 
+	httpAddr := flag.String("http-addr", ":9300", "address to serve /metrics, /healthz and /readyz on")
+
+	influxURL := flag.String("influx-url", "", "InfluxDB v2 server URL, enables the Influx sink when set")
+	influxToken := flag.String("influx-token", "", "InfluxDB v2 API token")
+	influxOrg := flag.String("influx-org", "", "InfluxDB v2 organisation")
+	influxBucket := flag.String("influx-bucket", "", "InfluxDB v2 bucket")
+	influxTimeout := flag.Duration("influx-timeout", 10*time.Second, "timeout for a single InfluxDB write")
+
+	var features featureFlags
+	flag.BoolVar(&features.wind, "enable-wind", false, "include wind speed and direction readings")
+	flag.BoolVar(&features.dewPoint, "enable-dewpoint", false, "include dew point readings")
+	flag.BoolVar(&features.visibility, "enable-visibility", false, "include visibility readings")
+	flag.BoolVar(&features.road, "enable-road", false, "include road surface temperature and condition readings")
+
+	maxRetries := flag.Int("max-retries", 5, "maximum number of retries per fetch attempt before giving up")
+	retryBase := flag.Duration("retry-base", time.Second, "base delay for exponential backoff between retries")
+	retryMax := flag.Duration("retry-max", 2*time.Minute, "maximum delay between retries")
+	fetchTimeout := flag.Duration("fetch-timeout", 30*time.Second, "timeout for a single Trafikinfo API request")
+	breakerThreshold := flag.Int("breaker-threshold", 5, "consecutive failed fetches before the circuit breaker opens")
+	breakerCooldown := flag.Duration("breaker-cooldown", 5*time.Minute, "how long the circuit breaker stays open before a half-open probe")
+
+	logFormat := flag.String("log-format", "console", "log output format: json or console")
+	logLevel := flag.String("log-level", "info", "log level: debug, info, warn or error")
+
+	minInterval := flag.Duration("min-interval", 5*time.Minute, "lower bound on the adaptive poll interval")
+	maxInterval := flag.Duration("max-interval", 30*time.Minute, "upper bound on the adaptive poll interval")
+	historySize := flag.Int("history-size", 96, "number of samples to buffer per station for the history trend feature")
+
+	var countyNos stationNamesFlag
+	flag.Var(&countyNos, "county", "CountyNo to query for, can be passed multiple times")
+	var roadNos stationNamesFlag
+	flag.Var(&roadNos, "road", "RoadNumber to query for, can be passed multiple times")
+	var bbox bboxFlag
+	flag.Var(&bbox, "bbox", "bounding box minLon,minLat,maxLon,maxLat to query for")
+	discover := flag.Bool("discover", false, "periodically re-discover stations matching the selectors instead of a fixed set")
+
 	mcfg := mqtt.MustFlags(flag.String, flag.Bool)
 	flag.Parse()
 
+	configureLogging(*logFormat, *logLevel)
+
 	if *apiToken == "REQUIRED" {
-		log.Fatalln("A token is required to be able to query the Trafikinfo API")
-	}
-	if len(stationNames) == 0 {
-		log.Fatalln("At least one station name is required to be able to query the Trafikinfo API")
-	}
-
-	stationFilters := make([]trafikinfo.Filter, 0, len(stationNames))
-	for _, station := range stationNames {
-		stationFilters = append(stationFilters, trafikinfo.Equal("Name", station))
-	}
-
-	req, err := trafikinfo.NewRequest().
-		APIKey(*apiToken).
-		Query(
-			trafikinfo.NewQuery(wmp.ObjectType()).Filter(
-				trafikinfo.Or(stationFilters...),
-			).Include(
-				"Id", "Name",
-				"Observation.Air.Temperature.Value",
-				"Observation.Air.RelativeHumidity.Value",
-				"Observation.Aggregated30minutes.Precipitation.TotalWaterEquivalent.Value",
-				"Observation.Sample",
-			),
-		).Build()
+		slog.Error("a token is required to be able to query the Trafikinfo API")
+		os.Exit(1)
+	}
+
+	filters, err := selectorFilters(stationNames, countyNos, roadNos, bbox)
 	if err != nil {
-		log.Fatalf("invalid query: %v\n", err)
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+
+	discoverQuery, err := buildDiscoverQuery(*apiToken, filters)
+	if err != nil {
+		slog.Error("invalid discover query", "err", err)
+		os.Exit(1)
+	}
+
+	req, err := buildQuery(*apiToken, filters, features)
+	if err != nil {
+		slog.Error("invalid query", "err", err)
+		os.Exit(1)
 	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
-	data, err := retrieve(ctx, http.DefaultClient, req)
+	metrics := newMetrics()
+	go serveMetrics(ctx, *httpAddr, metrics)
+
+	retryCfg := retryConfig{
+		maxRetries: *maxRetries,
+		base:       *retryBase,
+		max:        *retryMax,
+		timeout:    *fetchTimeout,
+	}
+	breaker := newCircuitBreaker(*breakerThreshold, *breakerCooldown)
+
+	req = resolveFetchQuery(ctx, *apiToken, discoverQuery, *discover, features, *fetchTimeout, req, slog.Default())
+
+	data, err := fetchWithRetry(ctx, http.DefaultClient, req, retryCfg, breaker, metrics, slog.With("fetch_id", nextFetchID()))
 	if err != nil {
-		log.Fatalf("failed to fetch data from API: %s\n", err)
+		slog.Error("failed to fetch data from API", "err", err)
+		os.Exit(1)
 	}
-	log.Println("fetched initial data")
+	slog.Info("fetched initial data", "stations", len(data))
 
 	m, err := mqtt.New(ctx, mcfg())
 	if err != nil {
-		log.Fatalln(err)
+		slog.Error("failed to create MQTT client", "err", err)
+		os.Exit(1)
 	}
 
 	go func() {
 		for {
 			ok, err := m.Start()
 			if err != nil {
-				log.Printf("MQTT Error: %s", err)
+				slog.Error("MQTT error", "err", err)
 			}
 			if !ok && ctx.Err() == nil {
-				log.Fatalln("MQTT: could not (re)connect")
+				slog.Error("MQTT: could not (re)connect")
+				os.Exit(1)
 			}
 			time.Sleep(5 * time.Second)
-			log.Printf("MQTT: reconnecting")
+			slog.Info("MQTT: reconnecting")
 		}
 	}()
 
+	cadence := newCadenceTracker()
+
 	stations := map[string]client.Device{}
-	for _, item := range data {
-		station := newWeatherStation(
-			item.name, item.id, m,
-		)
-		stations[item.id] = station
-	}
+	syncStations(stations, data, features, m, cadence)
 
-	if len(stations) != len(stationNames) {
+	if !*discover && len(stations) != len(stationNames) {
 		notfound := []string{}
 		for _, id := range stationNames {
 			if _, ok := stations[id]; !ok {
 				notfound = append(notfound, id)
 			}
 		}
-		log.Printf("Station IDs %s could not be found\n", strings.Join(notfound, ", "))
+		slog.Warn("some stations could not be found", "station_ids", strings.Join(notfound, ", "))
+	}
+
+	history := NewHistoryStore(*historySize)
+	sinks := []Sink{NewMQTTSink(stations, metrics, history)}
+	if *influxURL != "" {
+		influx := NewInfluxSink(*influxURL, *influxToken, *influxOrg, *influxBucket, *influxTimeout)
+		defer influx.Close()
+		sinks = append(sinks, influx)
+		slog.Info("Influx: publishing samples", "url", *influxURL)
 	}
 
-	update(data, stations)
-	log.Println("MQTT: published initial sensor data")
+	update(data, sinks, metrics)
+	metrics.setReady(true)
+	slog.Info("published initial sensor data")
+
+	for _, item := range data {
+		cadence.observe(item)
+	}
 
 loop:
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Received shutdown signal, terminating")
+			slog.Info("received shutdown signal, terminating")
 			break loop
-		// Publish after every interval has elapsed
-		case <-time.After(time.Duration(10 * time.Minute)):
-			data, err := retrieve(ctx, http.DefaultClient, req)
+		// Publish shortly after the next sample is expected, rather than
+		// on a fixed interval.
+		case <-time.After(cadence.next(*minInterval, *maxInterval)):
+			fetchLog := slog.With("fetch_id", nextFetchID())
+			req = resolveFetchQuery(ctx, *apiToken, discoverQuery, *discover, features, *fetchTimeout, req, fetchLog)
+
+			data, err := fetchWithRetry(ctx, http.DefaultClient, req, retryCfg, breaker, metrics, fetchLog)
 			if err != nil {
-				log.Printf("failed to fetch data from API: %s\n", err)
+				// Keep publishing the last known-good sample rather than
+				// overwriting it with nothing.
+				fetchLog.Error("failed to fetch data from API, keeping last known values", "err", err)
 				continue
 			}
-			update(data, stations)
+			syncStations(stations, data, features, m, cadence)
+			for _, item := range data {
+				cadence.observe(item)
+			}
+			update(data, sinks, metrics)
 		}
 	}
 	os.Exit(0)
 }
 
-func update(sensors []sensor, stations map[string]client.Device) {
+// update pushes every fetched reading through the metrics collector and
+// fans it out to each configured Sink.
+func update(sensors []sensor, sinks []Sink, metrics *Metrics) {
 	for _, item := range sensors {
-		station, ok := stations[item.id]
-		if !ok {
-			continue
-		}
-
-		if item.tempC != nil {
-			err := station.Feature("currentTemperature").Update(
-				strconv.FormatFloat(*item.tempC, 'f', 1, 32),
-			)
-			if err != nil {
-				log.Printf("MQTT: failed to publish temperature: %s\n", err)
-			}
-		}
-
-		if item.rhPct != nil {
-			err := station.Feature("currentRelativeHumidity").Update(
-				strconv.FormatFloat(*item.rhPct, 'f', 1, 32),
-			)
-			if err != nil {
-				log.Printf("MQTT: failed to publish relative humidity: %s\n", err)
+		metrics.observe(item)
+
+		for _, s := range sinks {
+			if err := s.Publish(item); err != nil {
+				slog.Error("sink: failed to publish reading",
+					"station_id", item.id,
+					"station_name", item.name,
+					"err", err,
+				)
 			}
 		}
-
-		precip := 0.0
-		if item.precip != nil {
-			precip = *item.precip * 2
-		}
-		err := station.Feature("precipitation").Update(
-			strconv.FormatFloat(precip, 'f', 1, 32),
-		)
-		if err != nil {
-			log.Printf("MQTT: failed to publish precipitation: %s\n", err)
-		}
 	}
 }
 
 type sensor struct {
-	id     string
-	name   string
-	tempC  *float64
-	rhPct  *float64
-	precip *float64
+	id       string
+	name     string
+	tempC    *float64
+	rhPct    *float64
+	precip   *float64
+	sampleAt time.Time
+
+	windSpeed     *float64
+	windDirection *float64
+	dewPoint      *float64
+	visibility    *float64
+	roadTemp      *float64
+	roadCondition *string
 }
 
-func retrieve(ctx context.Context, client *http.Client, body []byte) ([]sensor, error) {
-	httpReq, err := http.NewRequest(http.MethodPost, trafikinfo.Endpoint, bytes.NewBuffer(body))
+// doFetch executes a Trafikinfo query and returns the decoded envelope.
+// Network failures and non-200 responses are wrapped in a fetchError so
+// callers can decide whether a retry is worthwhile; decode and API-level
+// errors are returned as plain errors.
+func doFetch(ctx context.Context, client *http.Client, body []byte) (*wmp.Response, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, trafikinfo.Endpoint, bytes.NewBuffer(body))
 	if err != nil {
 		return nil, err
 	}
@@ -208,7 +279,9 @@ func retrieve(ctx context.Context, client *http.Client, body []byte) ([]sensor,
 
 	resp, err := client.Do(httpReq)
 	if err != nil {
-		return nil, err
+		// Network-level failures carry no status code; treat them as
+		// transient so the caller retries.
+		return nil, &fetchError{err: err}
 	}
 
 	defer func() {
@@ -218,7 +291,15 @@ func retrieve(ctx context.Context, client *http.Client, body []byte) ([]sensor,
 
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, &fetchError{err: err, statusCode: resp.StatusCode, header: resp.Header}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &fetchError{
+			err:        fmt.Errorf("http code: %d", resp.StatusCode),
+			statusCode: resp.StatusCode,
+			header:     resp.Header,
+		}
 	}
 
 	var wr wmp.Response
@@ -226,30 +307,82 @@ func retrieve(ctx context.Context, client *http.Client, body []byte) ([]sensor,
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK || wr.HasErrors() {
-		return nil, fmt.Errorf("http code: %d, error: %s", resp.StatusCode, wr.ErrorMsg())
+	if wr.HasErrors() {
+		return nil, fmt.Errorf("trafikinfo error: %s", wr.ErrorMsg())
 	}
 
 	if numRes := len(wr.Results); numRes != 1 {
 		return nil, fmt.Errorf("expected 1 query result, got %d", numRes)
 	}
 
+	return &wr, nil
+}
+
+func retrieve(ctx context.Context, client *http.Client, body []byte) ([]sensor, error) {
+	wr, err := doFetch(ctx, client, body)
+	if err != nil {
+		return nil, err
+	}
+
 	sensors := []sensor{}
 	for _, mp := range wr.Results[0].Data {
-		// Don't bother updating if samples are old. This usually indicates the station is
-		// malfunctioning or offline for maintenance
-		if mp.Observation().Sample().Before(time.Now().Add(-1 * time.Hour)) {
+		sampleAt := mp.Observation().Sample()
+		// Don't bother updating if samples are old or missing entirely.
+		// This usually indicates the station is malfunctioning or offline
+		// for maintenance.
+		if sampleAt == nil || sampleAt.Before(time.Now().Add(-1*time.Hour)) {
 			continue
 		}
 
+		var windSpeed, windDirection *float64
+		if winds := mp.Observation().Wind(); len(winds) > 0 {
+			windSpeed = winds[0].Speed().Value()
+			windDirection = winds[0].Direction().Value()
+		}
+
+		// Road temperature and condition are requested together (see
+		// featureFlags); without a road temperature the water/ice/snow
+		// flags were not requested either and would all read as false.
+		roadTemp := mp.Observation().Surface().Temperature().Value()
+		var roadCondition *string
+		if roadTemp != nil {
+			roadCondition = surfaceConditionString(mp.Observation().Surface())
+		}
+
 		sensors = append(sensors, sensor{
-			id:     *mp.ID(),
-			name:   *mp.Name(),
-			tempC:  mp.Observation().Air().Temperature().Value(),
-			rhPct:  mp.Observation().Air().RelativeHumidity().Value(),
-			precip: mp.Observation().Aggregated30minutes().Precipitation().TotalWaterEquivalent().Value(),
+			id:       *mp.ID(),
+			name:     *mp.Name(),
+			tempC:    mp.Observation().Air().Temperature().Value(),
+			rhPct:    mp.Observation().Air().RelativeHumidity().Value(),
+			precip:   mp.Observation().Aggregated30minutes().Precipitation().TotalWaterEquivalent().Value(),
+			sampleAt: *sampleAt,
+
+			windSpeed:     windSpeed,
+			windDirection: windDirection,
+			dewPoint:      mp.Observation().Air().Dewpoint().Value(),
+			visibility:    mp.Observation().Air().VisibleDistance().Value(),
+			roadTemp:      roadTemp,
+			roadCondition: roadCondition,
 		})
 	}
 
 	return sensors, nil
 }
+
+// surfaceConditionString derives a coarse road condition label from the
+// water/ice/snow flags Trafikinfo reports for the road surface; the
+// schema has no single "condition" field to read directly.
+func surfaceConditionString(sc wmp.SurfaceCondition) *string {
+	var s string
+	switch {
+	case sc.Ice():
+		s = "ice"
+	case sc.Snow():
+		s = "snow"
+	case sc.Water():
+		s = "wet"
+	default:
+		s = "dry"
+	}
+	return &s
+}
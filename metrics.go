@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics holds the Prometheus collectors exposed by trafikvader. Callers
+// feed it observations as they happen; it does not reach back into the
+// fetch/publish pipeline itself.
+type Metrics struct {
+	temperature   *prometheus.GaugeVec
+	humidity      *prometheus.GaugeVec
+	precipitation *prometheus.GaugeVec
+	sampleAge     *sampleAgeCollector
+
+	fetchTotal     *prometheus.CounterVec
+	fetchRetries   prometheus.Counter
+	mqttPublishErr *prometheus.CounterVec
+	breakerOpen    prometheus.Gauge
+
+	ready atomic.Bool
+}
+
+// sampleAgeCollector reports, at scrape time, how long ago each station's
+// most recent sample was recorded. A plain Gauge.Set() at fetch time would
+// freeze between fetches and keep reporting a stale "last known age"
+// instead of a growing one, which is exactly wrong during an outage (e.g.
+// while the circuit breaker is open and no fetches are happening at all).
+type sampleAgeCollector struct {
+	desc *prometheus.Desc
+
+	mu      sync.Mutex
+	samples map[string]sampleAgeEntry
+}
+
+type sampleAgeEntry struct {
+	name string
+	at   time.Time
+}
+
+func newSampleAgeCollector() *sampleAgeCollector {
+	return &sampleAgeCollector{
+		desc: prometheus.NewDesc(
+			"trafikvader_sample_age_seconds",
+			"Age of the most recently published sample for a station.",
+			[]string{"station_id", "station_name"}, nil,
+		),
+		samples: map[string]sampleAgeEntry{},
+	}
+}
+
+func (c *sampleAgeCollector) observe(id, name string, at time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.samples[id] = sampleAgeEntry{name: name, at: at}
+}
+
+func (c *sampleAgeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *sampleAgeCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for id, e := range c.samples {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, now.Sub(e.at).Seconds(), id, e.name)
+	}
+}
+
+func newMetrics() *Metrics {
+	stationLabels := []string{"station_id", "station_name"}
+
+	return &Metrics{
+		temperature: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "trafikvader_temperature_celsius",
+			Help: "Current air temperature reported by the station.",
+		}, stationLabels),
+		humidity: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "trafikvader_relative_humidity_percent",
+			Help: "Current relative humidity reported by the station.",
+		}, stationLabels),
+		precipitation: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "trafikvader_precipitation_mm_per_hour",
+			Help: "Precipitation rate derived from the 30 minute aggregate.",
+		}, stationLabels),
+		sampleAge: func() *sampleAgeCollector {
+			c := newSampleAgeCollector()
+			prometheus.MustRegister(c)
+			return c
+		}(),
+		fetchTotal: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "trafikvader_api_fetch_total",
+			Help: "Trafikinfo API fetches, partitioned by outcome.",
+		}, []string{"outcome"}),
+		fetchRetries: promauto.NewCounter(prometheus.CounterOpts{
+			Name: "trafikvader_api_fetch_retries_total",
+			Help: "Number of retry attempts made against the Trafikinfo API.",
+		}),
+		mqttPublishErr: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "trafikvader_mqtt_publish_errors_total",
+			Help: "MQTT publish errors, partitioned by feature.",
+		}, []string{"feature"}),
+		breakerOpen: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "trafikvader_circuit_breaker_open",
+			Help: "1 if the Trafikinfo circuit breaker is currently open, 0 otherwise.",
+		}),
+	}
+}
+
+// observe updates the per-station gauges from a freshly fetched sensor
+// reading.
+func (m *Metrics) observe(item sensor) {
+	labels := prometheus.Labels{"station_id": item.id, "station_name": item.name}
+
+	if item.tempC != nil {
+		m.temperature.With(labels).Set(*item.tempC)
+	}
+	if item.rhPct != nil {
+		m.humidity.With(labels).Set(*item.rhPct)
+	}
+	if item.precip != nil {
+		m.precipitation.With(labels).Set(precipRateMmPerHour(*item.precip))
+	}
+	if !item.sampleAt.IsZero() {
+		m.sampleAge.observe(item.id, item.name, item.sampleAt)
+	}
+}
+
+func (m *Metrics) fetchOK()            { m.fetchTotal.WithLabelValues("success").Inc() }
+func (m *Metrics) fetchFailed()        { m.fetchTotal.WithLabelValues("failure").Inc() }
+func (m *Metrics) fetchRetry()         { m.fetchRetries.Inc() }
+func (m *Metrics) publishErr(f string) { m.mqttPublishErr.WithLabelValues(f).Inc() }
+func (m *Metrics) setReady(v bool)     { m.ready.Store(v) }
+func (m *Metrics) setBreakerOpen(open bool) {
+	if open {
+		m.breakerOpen.Set(1)
+		return
+	}
+	m.breakerOpen.Set(0)
+}
+
+// serveMetrics starts the embedded HTTP server exposing /metrics,
+// /healthz and /readyz. It runs until ctx is cancelled.
+func serveMetrics(ctx context.Context, addr string, m *Metrics) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if !m.ready.Load() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	})
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		slog.Error("metrics: HTTP server stopped", "err", err)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"code.dny.dev/trafikinfo"
+	wmp "code.dny.dev/trafikinfo/trv/weathermeasurepoint/v2"
+)
+
+// buildQuery constructs a Trafikinfo request body matching filters,
+// requesting the sensor fields enabled by features.
+func buildQuery(apiToken string, filters []trafikinfo.Filter, features featureFlags) ([]byte, error) {
+	return trafikinfo.NewRequest().
+		APIKey(apiToken).
+		Query(
+			trafikinfo.NewQuery(wmp.ObjectType()).Filter(
+				trafikinfo.Or(filters...),
+			).Include(features.includeFields()...),
+		).Build()
+}
+
+// buildDiscoverQuery constructs a lightweight request that only returns
+// station identity and location, used by -discover mode to find newly
+// appearing or disappearing stations without paying for the full sensor
+// payload.
+func buildDiscoverQuery(apiToken string, filters []trafikinfo.Filter) ([]byte, error) {
+	return trafikinfo.NewRequest().
+		APIKey(apiToken).
+		Query(
+			trafikinfo.NewQuery(wmp.ObjectType()).Filter(
+				trafikinfo.Or(filters...),
+			).Include("Id", "Name", "Geometry"),
+		).Build()
+}
+
+// buildIDQuery constructs a full-fields request restricted to a known
+// set of station ids, used to fetch data for the stations -discover
+// mode found on its most recent lightweight pass.
+func buildIDQuery(apiToken string, ids []string, features featureFlags) ([]byte, error) {
+	filters := make([]trafikinfo.Filter, 0, len(ids))
+	for _, id := range ids {
+		filters = append(filters, trafikinfo.Equal("Id", id))
+	}
+	return buildQuery(apiToken, filters, features)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// fetchError wraps a failed retrieve() call with enough HTTP context to
+// decide whether it's worth retrying and whether the server asked us to
+// back off for a specific duration.
+type fetchError struct {
+	err        error
+	statusCode int
+	header     http.Header
+}
+
+func (e *fetchError) Error() string { return e.err.Error() }
+func (e *fetchError) Unwrap() error { return e.err }
+
+// retryable reports whether the failure looks transient: network errors
+// (status 0), 429s and 5xx responses are worth another attempt; anything
+// else (bad request, auth failure, malformed response) is not.
+func (e *fetchError) retryable() bool {
+	return e.statusCode == 0 || e.statusCode == http.StatusTooManyRequests || e.statusCode >= 500
+}
+
+// retryAfter parses the Retry-After header, supporting both the
+// delay-seconds and HTTP-date forms. ok is false if absent or unparseable.
+func (e *fetchError) retryAfter() (d time.Duration, ok bool) {
+	if e.header == nil {
+		return 0, false
+	}
+	v := e.header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t), true
+	}
+	return 0, false
+}
+
+// retryConfig bounds the backoff applied between failed fetch attempts.
+type retryConfig struct {
+	maxRetries int
+	base       time.Duration
+	max        time.Duration
+	timeout    time.Duration
+}
+
+// backoff returns the delay before retry attempt n (0-indexed): bounded
+// exponential growth with full jitter, so a fleet of instances doesn't
+// retry in lockstep.
+func (c retryConfig) backoff(n int) time.Duration {
+	d := float64(c.base) * math.Pow(2, float64(n))
+	if d > float64(c.max) {
+		d = float64(c.max)
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+var errCircuitOpen = errors.New("trafikinfo: circuit breaker open, skipping fetch")
+
+// fetchWithRetry calls retrieve, retrying transient failures with bounded
+// backoff until cfg.maxRetries is exhausted or ctx is cancelled. It
+// consults and updates cb so repeated failures eventually stop hammering
+// the API, and honours any Retry-After header the server returns. log
+// should already carry the fetch cycle's correlation id.
+func fetchWithRetry(ctx context.Context, client *http.Client, body []byte, cfg retryConfig, cb *circuitBreaker, metrics *Metrics, log *slog.Logger) ([]sensor, error) {
+	if !cb.allow() {
+		metrics.setBreakerOpen(true)
+		return nil, errCircuitOpen
+	}
+	metrics.setBreakerOpen(false)
+
+	var lastErr error
+	attempts := 0
+	for attempt := 0; attempt <= cfg.maxRetries; attempt++ {
+		attempts++
+		fetchCtx, cancel := context.WithTimeout(ctx, cfg.timeout)
+		data, err := retrieve(fetchCtx, client, body)
+		cancel()
+
+		if err == nil {
+			cb.success()
+			metrics.fetchOK()
+			return data, nil
+		}
+
+		lastErr = err
+		metrics.fetchFailed()
+		cb.failure()
+		if !cb.allow() {
+			metrics.setBreakerOpen(true)
+			break
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		var fe *fetchError
+		retryable := errors.As(err, &fe) && fe.retryable()
+		if attempt == cfg.maxRetries || !retryable {
+			break
+		}
+
+		wait := cfg.backoff(attempt)
+		if fe != nil {
+			if ra, ok := fe.retryAfter(); ok && ra > wait {
+				wait = ra
+			}
+		}
+
+		metrics.fetchRetry()
+		attrs := []any{
+			"attempt", attempt + 1,
+			"max_attempts", cfg.maxRetries + 1,
+			"retry_in", wait,
+			"err", err,
+		}
+		if fe != nil && fe.statusCode != 0 {
+			attrs = append(attrs, "http_status", fe.statusCode)
+		}
+		log.Warn("retrieve attempt failed, retrying", attrs...)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+
+	return nil, fmt.Errorf("retrieve: giving up after %d attempt(s): %w", attempts, lastErr)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryConfigBackoffBounds(t *testing.T) {
+	cfg := retryConfig{base: 100 * time.Millisecond, max: time.Second}
+
+	for n := 0; n < 10; n++ {
+		for i := 0; i < 20; i++ {
+			d := cfg.backoff(n)
+			if d < 0 {
+				t.Fatalf("attempt %d: backoff returned negative duration %v", n, d)
+			}
+			if d > cfg.max {
+				t.Fatalf("attempt %d: backoff %v exceeded configured max %v", n, d, cfg.max)
+			}
+		}
+	}
+}
+
+func TestRetryConfigBackoffGrowsWithAttempt(t *testing.T) {
+	cfg := retryConfig{base: time.Millisecond, max: time.Hour}
+
+	// backoff() applies full jitter, so a single call isn't representative;
+	// take the max of many draws per attempt as a proxy for the ceiling and
+	// check that it grows as n increases.
+	const samples = 200
+	prevMax := time.Duration(-1)
+	for n := 0; n < 5; n++ {
+		var observedMax time.Duration
+		for i := 0; i < samples; i++ {
+			if d := cfg.backoff(n); d > observedMax {
+				observedMax = d
+			}
+		}
+		if observedMax <= prevMax {
+			t.Fatalf("attempt %d: expected observed max backoff to grow, got %v after %v", n, observedMax, prevMax)
+		}
+		prevMax = observedMax
+	}
+}
+
+func TestRetryConfigBackoffZeroBaseIsZero(t *testing.T) {
+	cfg := retryConfig{base: 0, max: time.Second}
+
+	if d := cfg.backoff(0); d != 0 {
+		t.Fatalf("expected zero base to produce zero backoff, got %v", d)
+	}
+}
+
+func TestFetchErrorRetryable(t *testing.T) {
+	cases := []struct {
+		name       string
+		statusCode int
+		want       bool
+	}{
+		{"network error", 0, true},
+		{"too many requests", 429, true},
+		{"server error", 503, true},
+		{"bad request", 400, false},
+		{"unauthorized", 401, false},
+	}
+
+	for _, c := range cases {
+		e := &fetchError{statusCode: c.statusCode}
+		if got := e.retryable(); got != c.want {
+			t.Errorf("%s: retryable() = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
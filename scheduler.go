@@ -0,0 +1,90 @@
+package main
+
+import (
+	"math/rand"
+	"time"
+)
+
+// cadenceTracker observes per-station sample timestamps and estimates how
+// often each station publishes new data, so the poll loop can schedule
+// the next fetch shortly after the next sample is expected instead of
+// guessing a fixed interval.
+type cadenceTracker struct {
+	stations map[string]*stationCadence
+}
+
+type stationCadence struct {
+	lastSample time.Time
+	interval   time.Duration
+}
+
+func newCadenceTracker() *cadenceTracker {
+	return &cadenceTracker{stations: map[string]*stationCadence{}}
+}
+
+// observe feeds a freshly fetched reading into the tracker.
+func (c *cadenceTracker) observe(item sensor) {
+	if item.sampleAt.IsZero() {
+		return
+	}
+
+	sc, ok := c.stations[item.id]
+	if !ok {
+		c.stations[item.id] = &stationCadence{lastSample: item.sampleAt}
+		return
+	}
+
+	if !item.sampleAt.After(sc.lastSample) {
+		return
+	}
+
+	observed := item.sampleAt.Sub(sc.lastSample)
+	if sc.interval == 0 {
+		sc.interval = observed
+	} else {
+		// Exponential moving average smooths out occasional jitter in the
+		// station's own publishing cadence.
+		sc.interval = (sc.interval*3 + observed) / 4
+	}
+	sc.lastSample = item.sampleAt
+}
+
+// forget discards id's tracked cadence. Callers must invoke this when a
+// station stops appearing in fetch results: otherwise its stale
+// lastSample+interval keeps landing in the past, which pins next()'s
+// soonest-expected-sample to that stale value and collapses the adaptive
+// interval to min for every station, not just the missing one.
+func (c *cadenceTracker) forget(id string) {
+	delete(c.stations, id)
+}
+
+// next returns how long to wait before the next fetch, timed to land
+// shortly after the soonest station is expected to publish a new sample.
+// The result is clamped to [min, max] and carries a small random skew so
+// that many instances watching the same stations don't poll in lockstep.
+func (c *cadenceTracker) next(min, max time.Duration) time.Duration {
+	if len(c.stations) == 0 {
+		return min
+	}
+
+	var soonest time.Time
+	for _, sc := range c.stations {
+		interval := sc.interval
+		if interval == 0 {
+			interval = min
+		}
+		expected := sc.lastSample.Add(interval)
+		if soonest.IsZero() || expected.Before(soonest) {
+			soonest = expected
+		}
+	}
+
+	wait := time.Until(soonest) + time.Duration(rand.Int63n(int64(30*time.Second)))
+	if wait < min {
+		wait = min
+	}
+	if wait > max {
+		wait = max
+	}
+	return wait
+}
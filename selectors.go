@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"code.dny.dev/trafikinfo"
+)
+
+// bboxFlag parses a "-bbox=minLon,minLat,maxLon,maxLat" flag into a
+// geographic bounding box.
+type bboxFlag struct {
+	set                            bool
+	minLon, minLat, maxLon, maxLat float64
+}
+
+func (b *bboxFlag) String() string {
+	if !b.set {
+		return ""
+	}
+	return fmt.Sprintf("%g,%g,%g,%g", b.minLon, b.minLat, b.maxLon, b.maxLat)
+}
+
+func (b *bboxFlag) Set(value string) error {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return fmt.Errorf("bbox must be minLon,minLat,maxLon,maxLat")
+	}
+
+	var vals [4]float64
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return fmt.Errorf("bbox: invalid coordinate %q: %w", p, err)
+		}
+		vals[i] = v
+	}
+
+	b.minLon, b.minLat, b.maxLon, b.maxLat = vals[0], vals[1], vals[2], vals[3]
+	b.set = true
+	return nil
+}
+
+// selectorFilters builds the Or'd set of Trafikinfo filters matching any
+// of the configured station selectors. At least one of names, counties,
+// roads or bbox must be set.
+func selectorFilters(names, counties, roads []string, bbox bboxFlag) ([]trafikinfo.Filter, error) {
+	var filters []trafikinfo.Filter
+
+	for _, name := range names {
+		filters = append(filters, trafikinfo.Equal("Name", name))
+	}
+	for _, county := range counties {
+		filters = append(filters, trafikinfo.Equal("CountyNo", county))
+	}
+	for _, road := range roads {
+		filters = append(filters, trafikinfo.Equal("RoadNumber", road))
+	}
+	if bbox.set {
+		// radius is unused for a box shape; Within also serves circle
+		// selectors, where it gives the search radius around value.
+		filters = append(filters, trafikinfo.Within(
+			"Geometry.WGS84",
+			fmt.Sprintf("box((%g %g, %g %g))", bbox.minLon, bbox.minLat, bbox.maxLon, bbox.maxLat),
+			"box",
+			0,
+		))
+	}
+
+	if len(filters) == 0 {
+		return nil, fmt.Errorf("at least one of -name, -county, -road or -bbox is required")
+	}
+
+	return filters, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"log/slog"
+	"strconv"
+
+	"lib.hemtjan.st/client"
+)
+
+// Sink receives sensor readings as they are fetched and publishes them
+// somewhere. Multiple sinks can be fanned out to from update() so the same
+// sample can, for example, be pushed to both MQTT and a time-series DB.
+type Sink interface {
+	Publish(item sensor) error
+}
+
+// MQTTSink publishes readings as hemtjänst feature updates over MQTT, one
+// client.Device per station.
+type MQTTSink struct {
+	stations map[string]client.Device
+	metrics  *Metrics
+	history  *HistoryStore
+}
+
+// NewMQTTSink wraps an already-registered set of hemtjänst devices as a
+// Sink. Every published reading is also buffered in history and
+// republished as a private trend blob (see HistoryStore) on the
+// "history" feature.
+func NewMQTTSink(stations map[string]client.Device, metrics *Metrics, history *HistoryStore) *MQTTSink {
+	return &MQTTSink{stations: stations, metrics: metrics, history: history}
+}
+
+func (s *MQTTSink) Publish(item sensor) error {
+	station, ok := s.stations[item.id]
+	if !ok {
+		return nil
+	}
+
+	s.updateFloat(station, item, "currentTemperature", item.tempC)
+	s.updateFloat(station, item, "currentRelativeHumidity", item.rhPct)
+
+	precip := 0.0
+	if item.precip != nil {
+		precip = precipRateMmPerHour(*item.precip)
+	}
+	s.updateFloat(station, item, "precipitation", &precip)
+
+	s.updateFloat(station, item, "windSpeed", item.windSpeed)
+	s.updateFloat(station, item, "windDirection", item.windDirection)
+	s.updateFloat(station, item, "dewPoint", item.dewPoint)
+	s.updateFloat(station, item, "visibility", item.visibility)
+	s.updateFloat(station, item, "roadTemperature", item.roadTemp)
+	s.updateString(station, item, "roadCondition", item.roadCondition)
+
+	s.history.Record(item)
+	if blob := s.history.Blob(item.id); blob != "" {
+		if err := station.Feature("history").Update(blob); err != nil {
+			s.metrics.publishErr("history")
+			slog.Error("MQTT: failed to publish feature",
+				"feature", "history", "station_id", item.id, "station_name", item.name, "err", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *MQTTSink) updateFloat(station client.Device, item sensor, name string, v *float64) {
+	if v == nil {
+		return
+	}
+	if err := station.Feature(name).Update(strconv.FormatFloat(*v, 'f', 1, 32)); err != nil {
+		s.metrics.publishErr(name)
+		slog.Error("MQTT: failed to publish feature",
+			"feature", name, "station_id", item.id, "station_name", item.name, "err", err)
+	}
+}
+
+func (s *MQTTSink) updateString(station client.Device, item sensor, name string, v *string) {
+	if v == nil {
+		return
+	}
+	if err := station.Feature(name).Update(*v); err != nil {
+		s.metrics.publishErr(name)
+		slog.Error("MQTT: failed to publish feature",
+			"feature", name, "station_id", item.id, "station_name", item.name, "err", err)
+	}
+}
@@ -0,0 +1,8 @@
+package main
+
+// precipRateMmPerHour converts the 30 minute aggregated precipitation
+// total Trafikinfo reports (mm per 30 minutes) into a per-hour rate, the
+// unit exposed on every sink and metric.
+func precipRateMmPerHour(totalWaterEquivalent float64) float64 {
+	return totalWaterEquivalent * 2
+}